@@ -0,0 +1,60 @@
+package hasher
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher returns a Hasher that derives keys with Argon2id.
+func NewArgon2idHasher(params Argon2idParams) Hasher {
+	return &argon2idHasher{params: params}
+}
+
+func (h *argon2idHasher) Hash(password []byte) (string, error) {
+	salt, err := randomSalt(h.params.SaltLen)
+	if err != nil {
+		return "", err
+	}
+
+	sum := argon2.IDKey(password, salt, h.params.Time, h.params.Memory, h.params.Threads, h.params.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Time, h.params.Threads,
+		b64Encode(salt), b64Encode(sum)), nil
+}
+
+func (h *argon2idHasher) Verify(password []byte, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, errMalformedHash
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errMalformedHash
+	}
+
+	salt, err := b64Decode(parts[4])
+	if err != nil {
+		return false, errMalformedHash
+	}
+	sum, err := b64Decode(parts[5])
+	if err != nil {
+		return false, errMalformedHash
+	}
+
+	candidate := argon2.IDKey(password, salt, time, memory, threads, uint32(len(sum)))
+	return constantTimeEqual(candidate, sum), nil
+}
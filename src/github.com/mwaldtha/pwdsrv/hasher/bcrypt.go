@@ -0,0 +1,43 @@
+package hasher
+
+import "golang.org/x/crypto/bcrypt"
+
+// maxBcryptPasswordLen mirrors the hard limit golang.org/x/crypto/bcrypt
+// enforces internally; it isn't exported by that package.
+const maxBcryptPasswordLen = 72
+
+type bcryptHasher struct {
+	params BcryptParams
+}
+
+// NewBcryptHasher returns a Hasher that derives keys with bcrypt. bcrypt's
+// own encoded format already carries its cost and salt, so no additional
+// PHC wrapping is needed.
+func NewBcryptHasher(params BcryptParams) Hasher {
+	return &bcryptHasher{params: params}
+}
+
+// MaxPasswordLen reports bcrypt's 72-byte input limit.
+func (h *bcryptHasher) MaxPasswordLen() int {
+	return maxBcryptPasswordLen
+}
+
+func (h *bcryptHasher) Hash(password []byte) (string, error) {
+	sum, err := bcrypt.GenerateFromPassword(password, h.params.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(sum), nil
+}
+
+func (h *bcryptHasher) Verify(password []byte, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), password)
+	switch err {
+	case nil:
+		return true, nil
+	case bcrypt.ErrMismatchedHashAndPassword:
+		return false, nil
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,54 @@
+// Package hasher provides pluggable, memory-hard password hashing.
+//
+// Each supported algorithm produces a self-describing encoded string, so
+// the algorithm, its cost parameters, and the random salt travel with the
+// hash itself; nothing else needs to be persisted to verify it later.
+// Argon2id and scrypt use PHC string format (e.g.
+// "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>"); bcrypt uses its own
+// "$2a$<cost>$..." format as produced by golang.org/x/crypto/bcrypt.
+package hasher
+
+import "fmt"
+
+// Hasher computes and verifies password hashes using a specific algorithm.
+type Hasher interface {
+	// Hash computes an encoded hash for password.
+	Hash(password []byte) (string, error)
+	// Verify reports whether password matches the given encoded hash.
+	Verify(password []byte, encoded string) (bool, error)
+}
+
+// LengthLimiter is implemented by Hashers with a hard input length limit
+// (e.g. bcrypt's 72 bytes), so callers can reject oversized passwords
+// synchronously instead of discovering the failure after Hash runs.
+type LengthLimiter interface {
+	// MaxPasswordLen returns the longest password, in bytes, the Hasher
+	// can accept.
+	MaxPasswordLen() int
+}
+
+// Algorithm identifies a supported hashing algorithm.
+type Algorithm string
+
+const (
+	Argon2id Algorithm = "argon2id"
+	Bcrypt   Algorithm = "bcrypt"
+	Scrypt   Algorithm = "scrypt"
+)
+
+// DefaultAlgorithm is used when no algorithm is explicitly configured.
+const DefaultAlgorithm = Argon2id
+
+// New returns a Hasher for the named algorithm, configured with params.
+func New(alg Algorithm, params Params) (Hasher, error) {
+	switch alg {
+	case Argon2id:
+		return NewArgon2idHasher(params.Argon2id), nil
+	case Bcrypt:
+		return NewBcryptHasher(params.Bcrypt), nil
+	case Scrypt:
+		return NewScryptHasher(params.Scrypt), nil
+	default:
+		return nil, fmt.Errorf("hasher: unsupported algorithm %q", alg)
+	}
+}
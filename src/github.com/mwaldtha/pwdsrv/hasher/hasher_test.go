@@ -0,0 +1,74 @@
+package hasher
+
+import "testing"
+
+//cheap params so the tests don't pay full production KDF cost
+var testParams = Params{
+	Argon2id: Argon2idParams{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLen: 16, SaltLen: 8},
+	Bcrypt:   BcryptParams{Cost: 4},
+	Scrypt:   ScryptParams{N: 16, R: 8, P: 1, KeyLen: 16, SaltLen: 8},
+}
+
+var hasherAlgorithms = []Algorithm{Argon2id, Bcrypt, Scrypt}
+
+//Test that each algorithm's Hash output verifies against the original
+//password but rejects an incorrect one
+func TestHashAndVerify(t *testing.T) {
+	for _, alg := range hasherAlgorithms {
+		h, err := New(alg, testParams)
+		if err != nil {
+			t.Fatalf("New(%s): unexpected error: %v", alg, err)
+		}
+
+		encoded, err := h.Hash([]byte("angryMonkey"))
+		if err != nil {
+			t.Fatalf("%s: Hash returned an unexpected error: %v", alg, err)
+		}
+
+		ok, err := h.Verify([]byte("angryMonkey"), encoded)
+		if err != nil {
+			t.Fatalf("%s: Verify returned an unexpected error: %v", alg, err)
+		}
+		if !ok {
+			t.Errorf("%s: Verify did not accept the correct password", alg)
+		}
+
+		ok, err = h.Verify([]byte("wrongPassword"), encoded)
+		if err != nil {
+			t.Fatalf("%s: Verify returned an unexpected error: %v", alg, err)
+		}
+		if ok {
+			t.Errorf("%s: Verify accepted an incorrect password", alg)
+		}
+	}
+}
+
+//Test that New rejects an unknown algorithm name
+func TestNewUnsupportedAlgorithm(t *testing.T) {
+	if _, err := New(Algorithm("unknown"), testParams); err == nil {
+		t.Error("New(\"unknown\"): expected an error, got nil")
+	}
+}
+
+//Test that the bcrypt Hasher reports its length limit via LengthLimiter,
+//so callers can reject oversized input before calling Hash
+func TestBcryptHasherLengthLimiter(t *testing.T) {
+	h, err := New(Bcrypt, testParams)
+	if err != nil {
+		t.Fatalf("New(bcrypt): unexpected error: %v", err)
+	}
+
+	lim, ok := h.(LengthLimiter)
+	if !ok {
+		t.Fatal("expected the bcrypt Hasher to implement LengthLimiter")
+	}
+
+	max := lim.MaxPasswordLen()
+	if max != 72 {
+		t.Errorf("MaxPasswordLen: expected 72, got %d", max)
+	}
+
+	if _, err := h.Hash(make([]byte, max+1)); err == nil {
+		t.Error("Hash: expected an error for a password over MaxPasswordLen")
+	}
+}
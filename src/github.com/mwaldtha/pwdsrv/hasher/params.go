@@ -0,0 +1,66 @@
+package hasher
+
+import "golang.org/x/crypto/bcrypt"
+
+// Argon2idParams holds the cost parameters for the Argon2id KDF.
+type Argon2idParams struct {
+	Time    uint32 // number of iterations
+	Memory  uint32 // memory cost in KiB
+	Threads uint8  // degree of parallelism
+	KeyLen  uint32 // length of the derived key in bytes
+	SaltLen uint32 // length of the random salt in bytes
+}
+
+// DefaultArgon2idParams are the parameters recommended for interactive
+// logins by the Argon2id RFC draft.
+var DefaultArgon2idParams = Argon2idParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+	KeyLen:  32,
+	SaltLen: 16,
+}
+
+// BcryptParams holds the cost parameter for bcrypt.
+type BcryptParams struct {
+	Cost int
+}
+
+// DefaultBcryptParams matches golang.org/x/crypto/bcrypt's own default.
+var DefaultBcryptParams = BcryptParams{Cost: bcrypt.DefaultCost}
+
+// ScryptParams holds the cost parameters for scrypt.
+type ScryptParams struct {
+	N       int // CPU/memory cost parameter, must be a power of two
+	R       int // block size parameter
+	P       int // parallelization parameter
+	KeyLen  int // length of the derived key in bytes
+	SaltLen int // length of the random salt in bytes
+}
+
+// DefaultScryptParams matches the parameters suggested by Colin Percival's
+// original scrypt paper for interactive use.
+var DefaultScryptParams = ScryptParams{
+	N:       32768,
+	R:       8,
+	P:       1,
+	KeyLen:  32,
+	SaltLen: 16,
+}
+
+// Params bundles the configurable cost parameters for every supported
+// algorithm. New only consults the field matching the selected Algorithm.
+type Params struct {
+	Argon2id Argon2idParams
+	Bcrypt   BcryptParams
+	Scrypt   ScryptParams
+}
+
+// DefaultParams returns the recommended parameters for every algorithm.
+func DefaultParams() Params {
+	return Params{
+		Argon2id: DefaultArgon2idParams,
+		Bcrypt:   DefaultBcryptParams,
+		Scrypt:   DefaultScryptParams,
+	}
+}
@@ -0,0 +1,36 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var errMalformedHash = errors.New("hasher: malformed encoded hash")
+
+// randomSalt returns n bytes read from a cryptographically secure source.
+func randomSalt(n uint32) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("hasher: generating salt: %w", err)
+	}
+	return salt, nil
+}
+
+// b64Encode and b64Decode use unpadded standard base64, matching the PHC
+// string format convention used by Argon2id and scrypt reference hashes.
+func b64Encode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func b64Decode(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// constantTimeEqual reports whether a and b are equal without leaking
+// timing information about where they first differ.
+func constantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
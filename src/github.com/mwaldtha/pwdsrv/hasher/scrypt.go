@@ -0,0 +1,59 @@
+package hasher
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+type scryptHasher struct {
+	params ScryptParams
+}
+
+// NewScryptHasher returns a Hasher that derives keys with scrypt.
+func NewScryptHasher(params ScryptParams) Hasher {
+	return &scryptHasher{params: params}
+}
+
+func (h *scryptHasher) Hash(password []byte) (string, error) {
+	salt, err := randomSalt(uint32(h.params.SaltLen))
+	if err != nil {
+		return "", err
+	}
+
+	sum, err := scrypt.Key(password, salt, h.params.N, h.params.R, h.params.P, h.params.KeyLen)
+	if err != nil {
+		return "", fmt.Errorf("hasher: computing scrypt key: %w", err)
+	}
+
+	return fmt.Sprintf("$scrypt$n=%d,r=%d,p=%d$%s$%s",
+		h.params.N, h.params.R, h.params.P, b64Encode(salt), b64Encode(sum)), nil
+}
+
+func (h *scryptHasher) Verify(password []byte, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return false, errMalformedHash
+	}
+
+	var n, r, p int
+	if _, err := fmt.Sscanf(parts[2], "n=%d,r=%d,p=%d", &n, &r, &p); err != nil {
+		return false, errMalformedHash
+	}
+
+	salt, err := b64Decode(parts[3])
+	if err != nil {
+		return false, errMalformedHash
+	}
+	sum, err := b64Decode(parts[4])
+	if err != nil {
+		return false, errMalformedHash
+	}
+
+	candidate, err := scrypt.Key(password, salt, n, r, p, len(sum))
+	if err != nil {
+		return false, fmt.Errorf("hasher: computing scrypt key: %w", err)
+	}
+	return constantTimeEqual(candidate, sum), nil
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//Test that Middleware logs the documented fields and includes whatever
+//job id the wrapped handler recorded via SetJobID
+func TestMiddlewareLogsRequestFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetJobID(r.Context(), 42)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/hash", nil)
+	recorder := httptest.NewRecorder()
+
+	Middleware(logger, inner).ServeHTTP(recorder, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("unable to unmarshal log line %q: %v", buf.String(), err)
+	}
+
+	for _, field := range []string{"request_id", "method", "path", "status", "duration_ns", "job_id"} {
+		if _, ok := entry[field]; !ok {
+			t.Errorf("expected log entry to contain field %q, got: %s", field, buf.String())
+		}
+	}
+
+	if entry["method"] != http.MethodPost || entry["path"] != "/hash" {
+		t.Errorf("unexpected method/path in log entry: %s", buf.String())
+	}
+	if got := entry["status"].(float64); got != http.StatusCreated {
+		t.Errorf("expected status %d, got %v", http.StatusCreated, got)
+	}
+	if got := entry["job_id"].(float64); got != 42 {
+		t.Errorf("expected job_id 42, got %v", got)
+	}
+}
+
+//Test that a handler which never calls SetJobID logs job_id -1
+func TestMiddlewareDefaultsJobIDWhenUnset(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	recorder := httptest.NewRecorder()
+
+	Middleware(logger, inner).ServeHTTP(recorder, req)
+
+	if !strings.Contains(buf.String(), `"job_id":-1`) {
+		t.Errorf("expected job_id -1 in log entry, got: %s", buf.String())
+	}
+}
+
+//Test that LegacyStats derives total/average from the hash submission
+//duration histogram's sum and count, not from all HTTP traffic
+func TestLegacyStatsFromHistogram(t *testing.T) {
+	HashSubmissionDuration.Reset()
+
+	HashSubmissionDuration.WithLabelValues().Observe(0.1)
+	HashSubmissionDuration.WithLabelValues().Observe(0.3)
+
+	total, average := LegacyStats()
+	if total != 2 {
+		t.Errorf("expected total 2, got %d", total)
+	}
+	if average <= 0 {
+		t.Errorf("expected a positive average, got %v", average)
+	}
+}
@@ -1,56 +1,56 @@
 package main
 
 import (
-	"crypto/sha512"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/mwaldtha/pwdsrv/hasher"
+	"github.com/mwaldtha/pwdsrv/metrics"
+	"github.com/mwaldtha/pwdsrv/store"
+	"github.com/mwaldtha/pwdsrv/workerpool"
 )
 
 const (
 	passwordFormName string = "password"
+	encodedFormName  string = "encoded"
 )
 
-var hashes = make(map[int32]string)
-var lock = sync.RWMutex{}
-var jobCounter int32
-var hashStats atomic.Value
 var stopChan = make(chan os.Signal, 1)
-var stopping int32
 
+// HashStat mirrors the shape of the original hand-rolled stats so
+// existing /stats clients don't have to change, even though the values
+// now come from metrics.LegacyStats.
 type HashStat struct {
 	Total   int32   `json:"total"`
 	Average float64 `json:"average"`
 }
-type HashHandler struct{}
+type HashHandler struct {
+	Hasher hasher.Hasher
+	Store  store.Store
+	Pool   *workerpool.Pool
+}
+type VerifyHandler struct {
+	Hasher hasher.Hasher
+}
 type StatsHandler struct{}
 
 func (hh HashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	//don't allow requests to process if the server is stopping
-	if atomic.LoadInt32(&stopping) == 1 {
-		http.Error(w, "Server is stopping.", http.StatusServiceUnavailable)
-		return
-	}
-
-	log.Println("Begining hash request.")
-
 	// only support POST and GET requests
 	// return http.StatusMethodNotAllowed if any other HTTP method
 	switch r.Method {
 	case http.MethodGet:
-		log.Println("Processing hash GET.")
 		//find the job id in the URL
 		urlParts := strings.Split(r.URL.Path, "/")
 		if len(urlParts) >= 3 && urlParts[2] != "" {
@@ -60,16 +60,17 @@ func (hh HashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			log.Printf("Looking for job id %d.", jid)
-
-			lock.RLock()
-			jidHash := hashes[int32(jid)]
-			lock.RUnlock()
+			jidHash, found, err := hh.Store.Get(int32(jid))
+			if err != nil {
+				http.Error(w, "Unable to look up the specified job id.", http.StatusInternalServerError)
+				return
+			}
 
-			if jidHash == "" {
+			if !found {
 				http.Error(w, "Unable to find the specified job id.", http.StatusNotFound)
 				return
 			} else {
+				metrics.SetJobID(r.Context(), int32(jid))
 				w.WriteHeader(http.StatusOK)
 				w.Write([]byte(jidHash))
 			}
@@ -78,22 +79,44 @@ func (hh HashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case http.MethodPost:
-		log.Println("Processing hash POST.")
-		hashStart := time.Now()
+		start := time.Now()
 		p := r.PostFormValue(passwordFormName)
 		if p != "" {
-			//get the next job id
-			jid := atomic.AddInt32(&jobCounter, 1)
+			//reject input the configured Hasher can never hash, synchronously,
+			//rather than accepting it and leaving the job id stuck 404ing
+			//forever once hashAndEncode fails asynchronously
+			if lim, ok := hh.Hasher.(hasher.LengthLimiter); ok {
+				if max := lim.MaxPasswordLen(); len(p) > max {
+					http.Error(w, fmt.Sprintf("Password exceeds the maximum supported length of %d bytes for the configured hash algorithm.", max), http.StatusBadRequest)
+					return
+				}
+			}
 
-			//call after the handler completes
-			defer hashAndEncode(jid, p)
+			//get the next job id
+			jid, err := hh.Store.NextID()
+			if err != nil {
+				http.Error(w, "Unable to allocate a job id.", http.StatusInternalServerError)
+				return
+			}
+			metrics.SetJobID(r.Context(), jid)
+
+			//hand the actual KDF work off to the worker pool so this handler
+			//returns without waiting for the hash (Submit only blocks while the
+			//queue is full); a graceful shutdown drains the pool before exiting
+			metrics.JobsPending.Inc()
+			err = hh.Pool.Submit(func() {
+				defer metrics.JobsPending.Dec()
+				hh.hashAndEncode(jid, p)
+			})
+			if err != nil {
+				metrics.JobsPending.Dec()
+				http.Error(w, "Server is shutting down and cannot accept new hash jobs.", http.StatusServiceUnavailable)
+				return
+			}
 
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte(strconv.Itoa(int(jid))))
-
-			duration := time.Since(hashStart)
-			log.Printf("Hash request duration (nanoseconds): %s", strconv.FormatInt(duration.Nanoseconds(), 10))
-			updateStats(duration.Nanoseconds())
+			metrics.HashSubmissionDuration.WithLabelValues().Observe(time.Since(start).Seconds())
 		} else {
 			http.Error(w, "A value must be submitted.", http.StatusBadRequest)
 			return
@@ -101,25 +124,40 @@ func (hh HashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	default:
 		http.Error(w, "Only POST and GET requests are supported.", http.StatusMethodNotAllowed)
 	}
-
-	log.Println("Finished hash request.")
 }
 
-func (sh StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	//don't allow requests to process if the server is stopping
-	if atomic.LoadInt32(&stopping) == 1 {
-		http.Error(w, "Server is stopping.", http.StatusServiceUnavailable)
-		return
+func (vh VerifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// only support POST requests
+	// return http.StatusMethodNotAllowed if any other HTTP method
+	switch r.Method {
+	case http.MethodPost:
+		p := r.PostFormValue(passwordFormName)
+		encoded := r.PostFormValue(encodedFormName)
+		if p == "" || encoded == "" {
+			http.Error(w, "Both password and encoded values must be submitted.", http.StatusBadRequest)
+			return
+		}
+
+		valid, err := vh.Hasher.Verify([]byte(p), encoded)
+		if err != nil {
+			http.Error(w, "Unable to verify the supplied values.", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(strconv.FormatBool(valid)))
+	default:
+		http.Error(w, "Only POST requests are supported.", http.StatusMethodNotAllowed)
 	}
+}
 
-	log.Println("Begining stats request.")
+func (sh StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// only support GET requests
 	// return http.StatusMethodNotAllowed if any other HTTP method
 	switch r.Method {
 	case http.MethodGet:
-		log.Println("Processing stats GET.")
-		//get the JSON to return to the client
-		hsj, err := json.Marshal(hashStats.Load().(*HashStat))
+		total, average := metrics.LegacyStats()
+		hsj, err := json.Marshal(&HashStat{Total: int32(total), Average: average})
 		if err != nil {
 			http.Error(w, "Unable to generate stats.", http.StatusInternalServerError)
 			return
@@ -129,93 +167,168 @@ func (sh StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	default:
 		http.Error(w, "Only GET requests are supported.", http.StatusMethodNotAllowed)
 	}
-
-	log.Println("Finished stats request.")
 }
 
 func main() {
 	// process command line flag for port number or default to 8080
 	portFlag := flag.Int("port", 8080, "Port number the server will listen on.")
 
+	// hashing algorithm selection and its per-algorithm cost parameters;
+	// each defaults to its own environment variable if set
+	algorithmFlag := flag.String("hash-algorithm", envOrDefault("HASH_ALGORITHM", string(hasher.DefaultAlgorithm)),
+		"Password hashing algorithm to use: argon2id, bcrypt, or scrypt.")
+	argon2TimeFlag := flag.Uint("argon2-time", uint(envOrDefaultInt("HASH_ARGON2_TIME", int(hasher.DefaultArgon2idParams.Time))),
+		"Argon2id number of iterations.")
+	argon2MemoryFlag := flag.Uint("argon2-memory", uint(envOrDefaultInt("HASH_ARGON2_MEMORY", int(hasher.DefaultArgon2idParams.Memory))),
+		"Argon2id memory cost in KiB.")
+	argon2ParallelismFlag := flag.Uint("argon2-parallelism", uint(envOrDefaultInt("HASH_ARGON2_PARALLELISM", int(hasher.DefaultArgon2idParams.Threads))),
+		"Argon2id number of parallel threads.")
+	bcryptCostFlag := flag.Int("bcrypt-cost", envOrDefaultInt("HASH_BCRYPT_COST", hasher.DefaultBcryptParams.Cost),
+		"bcrypt cost factor.")
+	scryptNFlag := flag.Int("scrypt-n", envOrDefaultInt("HASH_SCRYPT_N", hasher.DefaultScryptParams.N),
+		"scrypt CPU/memory cost parameter N.")
+	scryptRFlag := flag.Int("scrypt-r", envOrDefaultInt("HASH_SCRYPT_R", hasher.DefaultScryptParams.R),
+		"scrypt block size parameter r.")
+	scryptPFlag := flag.Int("scrypt-p", envOrDefaultInt("HASH_SCRYPT_P", hasher.DefaultScryptParams.P),
+		"scrypt parallelization parameter p.")
+
+	// persistence backend selection for computed hashes
+	storeFlag := flag.String("store", envOrDefault("HASH_STORE", string(store.DefaultBackend)),
+		"Persistence backend for computed hashes: memory, file, or bolt.")
+	storePathFlag := flag.String("store-path", envOrDefault("HASH_STORE_PATH", ""),
+		"Backing file or database path for the file and bolt store backends.")
+
+	// worker pool sizing for the deferred hashAndEncode work
+	workersFlag := flag.Int("workers", envOrDefaultInt("HASH_WORKERS", 4),
+		"Number of worker goroutines processing hash jobs.")
+	queueSizeFlag := flag.Int("queue-size", envOrDefaultInt("HASH_QUEUE_SIZE", 100),
+		"Maximum number of queued hash jobs before the hash endpoint blocks.")
+	shutdownTimeoutFlag := flag.Duration("shutdown-timeout", 30*time.Second,
+		"Maximum time to wait for in-flight requests and queued hash jobs to finish during a graceful shutdown.")
+
 	flag.Parse()
-	//initialize the WaitGroup used when stopping the server
-	wg := sync.WaitGroup{}
-	//initialise the hashStats object before the server starts
-	hashStats.Store(&HashStat{Total: 0, Average: 0})
 
-	hashListener, err := net.Listen("tcp", fmt.Sprintf(":%d", *portFlag))
+	params := hasher.DefaultParams()
+	params.Argon2id.Time = uint32(*argon2TimeFlag)
+	params.Argon2id.Memory = uint32(*argon2MemoryFlag)
+	params.Argon2id.Threads = uint8(*argon2ParallelismFlag)
+	params.Bcrypt.Cost = *bcryptCostFlag
+	params.Scrypt.N = *scryptNFlag
+	params.Scrypt.R = *scryptRFlag
+	params.Scrypt.P = *scryptPFlag
+
+	h, err := hasher.New(hasher.Algorithm(*algorithmFlag), params)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	//handle various interrupts to stop the server gracefully
-	signal.Notify(stopChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-stopChan
-		//set global value used to indicate that the server is stopping
-		atomic.StoreInt32(&stopping, 1)
-		log.Println("Waiting for requests to finish.")
-		wg.Wait()
-		log.Println("Complete and shutting down.")
-		os.Exit(1)
-	}()
+	s, err := store.New(store.Backend(*storeFlag), *storePathFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pool := workerpool.New(*workersFlag, *queueSizeFlag)
+
+	//structured request logging: set as the default logger too, so
+	//background goroutines like hashAndEncode emit the same JSON shape
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
+
+	hashListener, err := net.Listen("tcp", fmt.Sprintf(":%d", *portFlag))
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	//register with and without the trailing slash to avoid redirect in the case of a POST request
-	http.Handle("/hash", HashHandler{})
-	http.Handle("/hash/", HashHandler{})
+	http.Handle("/hash", metrics.Middleware(logger, HashHandler{Hasher: h, Store: s, Pool: pool}))
+	http.Handle("/hash/", metrics.Middleware(logger, HashHandler{Hasher: h, Store: s, Pool: pool}))
+	http.Handle("/verify", metrics.Middleware(logger, VerifyHandler{Hasher: h}))
+	http.Handle("/verify/", metrics.Middleware(logger, VerifyHandler{Hasher: h}))
 	//only supporting GET requests, so the redirect when requested without the trailing slash is ok
 	//but registering both to avoid the unnecessary redirect
-	http.Handle("/stats", StatsHandler{})
-	http.Handle("/stats/", StatsHandler{})
+	http.Handle("/stats", metrics.Middleware(logger, StatsHandler{}))
+	http.Handle("/stats/", metrics.Middleware(logger, StatsHandler{}))
+	http.Handle("/metrics", metrics.Handler())
 
 	server := &http.Server{
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
-		//simple callback function for managing the WaitGroup used during shutdown
-		ConnState: func(conn net.Conn, state http.ConnState) {
-			switch state {
-			case http.StateNew:
-				wg.Add(1)
-			case http.StateHijacked, http.StateClosed:
-				wg.Done()
-			}
-		},
 	}
 
-	log.Printf("Starting server on port %d", *portFlag)
+	//handle various interrupts to stop the server gracefully
+	signal.Notify(stopChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
+	var shutdownFailed bool
+	go func() {
+		<-stopChan
+		logger.Info("received shutdown signal, waiting for requests and queued hash jobs to finish")
+
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeoutFlag)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error("error shutting down HTTP server", "error", err)
+			shutdownFailed = true
+		}
+		if err := pool.Shutdown(ctx); err != nil {
+			logger.Error("error draining the hash job queue", "error", err)
+			shutdownFailed = true
+		}
+		if err := s.Close(); err != nil {
+			logger.Error("error closing store", "error", err)
+			shutdownFailed = true
+		}
+
+		logger.Info("complete, shutting down")
+		close(shutdownDone)
+	}()
+
+	logger.Info("starting server", "port", *portFlag)
 	err = server.Serve(hashListener)
 
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatal("An error was received during Serve: ", err)
 	}
-}
-
-//private function to hash and encode the passed in data
-//store the computed value in the global hashes map for the supplied key
-func hashAndEncode(jid int32, data string) {
-	// wait 5 seconds before starting
-	time.Sleep(time.Duration(5) * time.Second)
 
-	log.Printf("Hashing and encoding: '%s'", data)
+	<-shutdownDone
 
-	lock.Lock()
-
-	h := sha512.New()
-	h.Write([]byte(data))
-	cs := h.Sum(nil)
+	if shutdownFailed {
+		os.Exit(1)
+	}
+}
 
-	hashes[jid] = base64.StdEncoding.EncodeToString(cs)
+//hashAndEncode hashes data with the handler's configured Hasher and
+//persists the encoded result in the handler's Store for the supplied job id
+func (hh HashHandler) hashAndEncode(jid int32, data string) {
+	start := time.Now()
+	encoded, err := hh.Hasher.Hash([]byte(data))
+	metrics.ComputeDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		slog.Error("hash computation failed", "job_id", jid, "error", err)
+		return
+	}
 
-	lock.Unlock()
+	if err := hh.Store.Put(jid, encoded); err != nil {
+		slog.Error("failed to persist hash", "job_id", jid, "error", err)
+	}
 }
 
-//update the stats total count and average values based on the most resent duration
-func updateStats(durationNano int64) {
-	hs := hashStats.Load().(*HashStat)
-	num := atomic.AddInt32(&hs.Total, 1)
-	durationMilli := float64(durationNano) / 1e6
-	avg := (((hs.Average * (float64(num) - 1)) + durationMilli) / float64(num))
+//envOrDefault returns the value of the named environment variable, or def
+//if it is unset
+func envOrDefault(key string, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
 
-	log.Printf("Adding duration (ms) %s to stats. New average: %s", strconv.FormatFloat(durationMilli, 'f', 5, 64), strconv.FormatFloat(avg, 'f', 5, 64))
-	hashStats.Store(&HashStat{Total: num, Average: avg})
+//envOrDefaultInt returns the named environment variable parsed as an int,
+//or def if it is unset or unparseable
+func envOrDefaultInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return def
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -11,8 +12,24 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/mwaldtha/pwdsrv/hasher"
+	"github.com/mwaldtha/pwdsrv/metrics"
+	"github.com/mwaldtha/pwdsrv/store"
+	"github.com/mwaldtha/pwdsrv/workerpool"
 )
 
+//testHasher returns a Hasher configured with cheap cost parameters so
+//tests don't pay full production KDF cost
+func testHasher() hasher.Hasher {
+	return hasher.NewBcryptHasher(hasher.BcryptParams{Cost: 4})
+}
+
+//testPool returns a small worker pool sized for test traffic
+func testPool() *workerpool.Pool {
+	return workerpool.New(4, 100)
+}
+
 //data for testing the actual hash/encoding process
 var testPasswords = []struct {
 	originalValue string
@@ -25,9 +42,13 @@ var testPasswords = []struct {
 	{" !~@#d{}[]WQS67*/?", "1CPHe9u49v+FXpdubV0IYYvNtkUn38l02Ijbw7Jn8JkSu54TgeVNDm4mWTAzm8iCedAdiWrlyWZ2diPycf67+Q=="},
 	{"Hello, 世界", "q5bnkSm2cCQbB/6S0TXdP5B6OKXUs2cn3J9HGgI+/jV+vIhKFuP1NvMYQ4nyB5gXf3IvisTGl+rHhfuZCHOLGw=="},
 	{"", "A value must be submitted."},
-	{"ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-", "KdRKHNcXx99I4FTpdQxqk4203FR1L8FwHDX0ovkuTB675g1c/BLMa78FSRguc6Ha/yIEF3+OxrFPnnSQqTML9A=="},
+	{"ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-ReallyLongPassword-", "Password exceeds the maximum supported length of 72 bytes for the configured hash algorithm."},
 }
 
+//maxTestHasherPasswordLen mirrors testHasher()'s bcrypt length limit, so
+//tests can tell which testPasswords entries are rejected synchronously
+const maxTestHasherPasswordLen = 72
+
 //data for testing how the HashHandler responds to various http methods
 var hashHandlerHttpMethods = []struct {
 	methodName   string
@@ -56,8 +77,7 @@ var statsHandlerHttpMethods = []struct {
 
 //Test to pass a simulated request through the HashHandler, hitting the POST processing code
 func TestHashHandlerPost(t *testing.T) {
-	handler := new(HashHandler)
-	hashStats.Store(&HashStat{Total: 0, Average: 0})
+	handler := &HashHandler{Hasher: testHasher(), Store: store.NewMemoryStore(), Pool: testPool()}
 	count := 0
 
 	for _, testPassword := range testPasswords {
@@ -76,7 +96,7 @@ func TestHashHandlerPost(t *testing.T) {
 
 		body := strings.TrimSpace(recorder.Body.String())
 
-		if testPassword.originalValue != "" {
+		if testPassword.originalValue != "" && len(testPassword.originalValue) <= maxTestHasherPasswordLen {
 			count++
 			jobInt, _ := strconv.Atoi(body)
 			if jobInt != count {
@@ -90,15 +110,63 @@ func TestHashHandlerPost(t *testing.T) {
 	}
 }
 
+//Test that a password over the configured Hasher's length limit is
+//rejected synchronously with 400, rather than accepted and left to fail
+//asynchronously in the worker pool
+func TestHashHandlerPostRejectsOverLengthPasswordSynchronously(t *testing.T) {
+	handler := &HashHandler{Hasher: testHasher(), Store: store.NewMemoryStore(), Pool: testPool()}
+
+	overLong := strings.Repeat("a", maxTestHasherPasswordLen+1)
+	recorder := httptest.NewRecorder()
+	req, newReqErr := http.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader(passwordFormName+"="+overLong))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	if newReqErr != nil {
+		t.Fatal("An error occured while creating the request: ", newReqErr)
+	}
+
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+//Test that a pool shut down before a POST arrives returns 503 instead of
+//panicking on a send to the pool's closed job queue
+func TestHashHandlerPostAfterPoolShutdownReturns503(t *testing.T) {
+	pool := testPool()
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: unexpected error: %v", err)
+	}
+
+	handler := &HashHandler{Hasher: testHasher(), Store: store.NewMemoryStore(), Pool: pool}
+
+	recorder := httptest.NewRecorder()
+	req, newReqErr := http.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader(passwordFormName+"=angryMonkey"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	if newReqErr != nil {
+		t.Fatal("An error occured while creating the request: ", newReqErr)
+	}
+
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
 //Test to pass a simulated request through the HashHandler, hitting the GET processing code
 func TestHashHandlerGet(t *testing.T) {
-	handler := new(HashHandler)
+	s := store.NewMemoryStore()
+	handler := &HashHandler{Hasher: testHasher(), Store: s}
 	count := int32(0)
 
 	for _, testPassword := range testPasswords {
 		recorder := httptest.NewRecorder()
 		count++
-		hashes[count] = testPassword.expectedValue
+		if err := s.Put(count, testPassword.expectedValue); err != nil {
+			t.Fatalf("Put: unexpected error: %v", err)
+		}
 
 		// create new request for each password in testPasswords
 		req, newReqErr := http.NewRequest(http.MethodGet, "http://localhost/hash/"+strconv.FormatInt(int64(count), 10), nil)
@@ -118,48 +186,43 @@ func TestHashHandlerGet(t *testing.T) {
 	}
 }
 
-//Test to pass a simulated request through the StatsHandler, hitting the GET processing code
+//Test to pass a simulated request through the StatsHandler, hitting the GET
+//processing code, backed by metrics.HashSubmissionDuration instead of the
+//old hand-rolled running average
 func TestStatsHandlerGet(t *testing.T) {
-	handler := new(StatsHandler)
+	metrics.HashSubmissionDuration.Reset()
+	metrics.HashSubmissionDuration.WithLabelValues().Observe(0.01)
+	metrics.HashSubmissionDuration.WithLabelValues().Observe(0.03)
 
-	for x := 1; x <= 10; x++ {
-		average := float64(x) * 10.0
-		hashStats.Store(&HashStat{Total: int32(x), Average: average})
-		recorder := httptest.NewRecorder()
-
-		// create new request for each password in testPasswords
-		// in this case the url specified below is not really used, so the value is irrelevant
-		req, newReqErr := http.NewRequest(http.MethodGet, "http://localhost/", nil)
-
-		if newReqErr != nil {
-			t.Error("An error occured while creating the request: ", newReqErr)
-		}
-
-		// process request through the handler
-		handler.ServeHTTP(recorder, req)
-
-		body := strings.TrimSpace(recorder.Body.String())
-		bodyBytes := []byte(body)
+	handler := new(StatsHandler)
+	recorder := httptest.NewRecorder()
 
-		var jsonMap map[string]interface{}
+	// in this case the url specified below is not really used, so the value is irrelevant
+	req, newReqErr := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	if newReqErr != nil {
+		t.Fatal("An error occured while creating the request: ", newReqErr)
+	}
 
-		if err := json.Unmarshal(bodyBytes, &jsonMap); err != nil {
-			t.Errorf("Unable to unmarshal the response body: '%s'", body)
-		}
+	// process request through the handler
+	handler.ServeHTTP(recorder, req)
 
-		total := jsonMap["total"].(float64)
-		avg := jsonMap["average"].(float64)
+	var stat HashStat
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stat); err != nil {
+		t.Fatalf("Unable to unmarshal the response body: %q: %v", recorder.Body.String(), err)
+	}
 
-		if total != float64(x) && avg != float64(average) {
-			t.Errorf("StatsHandlerGet test - unexpected response: %s", body)
-		}
+	if stat.Total != 2 {
+		t.Errorf("StatsHandlerGet test: expected total 2, got %d", stat.Total)
+	}
+	if stat.Average <= 0 {
+		t.Errorf("StatsHandlerGet test: expected a positive average, got %v", stat.Average)
 	}
 }
 
 // Test how the HashHandler responds to various HTTP methods
 // without starting up a server or passing in a password
 func TestHashHandlerHTTPMethods(t *testing.T) {
-	handler := new(HashHandler)
+	handler := &HashHandler{Hasher: testHasher(), Store: store.NewMemoryStore(), Pool: testPool()}
 
 	for _, method := range hashHandlerHttpMethods {
 		recorder := httptest.NewRecorder()
@@ -180,10 +243,57 @@ func TestHashHandlerHTTPMethods(t *testing.T) {
 	}
 }
 
+//Test to pass a simulated request through the VerifyHandler, hitting the POST processing code
+func TestVerifyHandlerPost(t *testing.T) {
+	h := testHasher()
+	handler := &VerifyHandler{Hasher: h}
+
+	encoded, hashErr := h.Hash([]byte("angryMonkey"))
+	if hashErr != nil {
+		t.Fatal("An error occured while hashing the test password: ", hashErr)
+	}
+
+	verifyTests := []struct {
+		password     string
+		encoded      string
+		expectedCode int
+		expectedBody string
+	}{
+		{"angryMonkey", encoded, http.StatusOK, "true"},
+		{"wrongPassword", encoded, http.StatusOK, "false"},
+		{"", encoded, http.StatusBadRequest, "Both password and encoded values must be submitted."},
+		{"angryMonkey", "", http.StatusBadRequest, "Both password and encoded values must be submitted."},
+	}
+
+	for _, verifyTest := range verifyTests {
+		recorder := httptest.NewRecorder()
+		form := url.Values{}
+		form.Set(passwordFormName, verifyTest.password)
+		form.Set(encodedFormName, verifyTest.encoded)
+		req, newReqErr := http.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+
+		if newReqErr != nil {
+			t.Error("An error occured while creating the request: ", newReqErr)
+		}
+
+		// process request through the handler
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != verifyTest.expectedCode {
+			t.Errorf("VerifyHandlerPost test (%s): expected code: %d, actual: %d", verifyTest.password, verifyTest.expectedCode, recorder.Code)
+		}
+
+		body := strings.TrimSpace(recorder.Body.String())
+		if body != verifyTest.expectedBody {
+			t.Errorf("VerifyHandlerPost test (%s): expected body: '%s', actual: '%s'", verifyTest.password, verifyTest.expectedBody, body)
+		}
+	}
+}
+
 // Test how the StatsHandler responds to various HTTP methods without starting up a server
 func TestStatsHandlerHTTPMethods(t *testing.T) {
 	handler := new(StatsHandler)
-	hashStats.Store(&HashStat{Total: 0, Average: 0})
 
 	for _, method := range statsHandlerHttpMethods {
 		recorder := httptest.NewRecorder()
@@ -207,7 +317,7 @@ func TestStatsHandlerHTTPMethods(t *testing.T) {
 //Test how the HashHandler responds to various HTTP methods
 //through a running server without passing in a password
 func TestHashHandlerServerHTTPMethods(t *testing.T) {
-	testServer := httptest.NewServer(new(HashHandler))
+	testServer := httptest.NewServer(&HashHandler{Hasher: testHasher(), Store: store.NewMemoryStore(), Pool: testPool()})
 	t.Logf("Running server at: %s", testServer.URL)
 
 	// close the server after this test finishes
@@ -273,9 +383,8 @@ func TestParallelHashHandlerPostRequests(t *testing.T) {
 
 	// use a WaitGroup to wait for all goroutines in this test to finish
 	var wg sync.WaitGroup
-	hashStats.Store(&HashStat{Total: 0, Average: 0})
 
-	testServer := httptest.NewServer(new(HashHandler))
+	testServer := httptest.NewServer(&HashHandler{Hasher: testHasher(), Store: store.NewMemoryStore(), Pool: testPool()})
 	t.Logf("Running server at: %s", testServer.URL)
 
 	// close the server after this test finishes
@@ -323,7 +432,7 @@ func doHashHandlerPostRequest(serverURL string, orig string, expected string, t
 		} else {
 			body := strings.TrimSpace(string(actual))
 
-			if orig != "" {
+			if orig != "" && len(orig) <= maxTestHasherPasswordLen {
 				_, err := strconv.Atoi(body)
 				if err != nil {
 					t.Errorf("HashHandlerPost test (%s): Unable to convert job id '%s'", orig, body)
@@ -336,3 +445,61 @@ func doHashHandlerPostRequest(serverURL string, orig string, expected string, t
 		}
 	}
 }
+
+//Test that submitting several hash jobs and then triggering a graceful
+//shutdown (as main does on SIGINT/SIGTERM) still lets every accepted job
+//id resolve via GET /hash/:id once the pool has drained
+func TestGracefulShutdownDrainsQueuedJobs(t *testing.T) {
+	s := store.NewMemoryStore()
+	pool := testPool()
+	handler := &HashHandler{Hasher: testHasher(), Store: s, Pool: pool}
+
+	var jids []int32
+	for _, testPassword := range testPasswords {
+		if testPassword.originalValue == "" {
+			continue
+		}
+		// testHasher() is bcrypt, which rejects passwords over 72 bytes
+		// synchronously (no job id is returned); skip those here since
+		// this test is about drain ordering, not per-algorithm input limits
+		if len(testPassword.originalValue) > maxTestHasherPasswordLen {
+			continue
+		}
+
+		recorder := httptest.NewRecorder()
+		req, newReqErr := http.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader(passwordFormName+"="+testPassword.originalValue))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+		if newReqErr != nil {
+			t.Fatal("An error occured while creating the request: ", newReqErr)
+		}
+
+		handler.ServeHTTP(recorder, req)
+
+		jid, err := strconv.Atoi(strings.TrimSpace(recorder.Body.String()))
+		if err != nil {
+			t.Fatalf("Unable to convert accepted job id: %v", err)
+		}
+		jids = append(jids, int32(jid))
+	}
+
+	// simulate the SIGTERM handler: drain the pool before looking anything up
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: unexpected error: %v", err)
+	}
+
+	for _, jid := range jids {
+		if _, found, err := s.Get(jid); err != nil || !found {
+			t.Errorf("job id %d: expected to resolve after shutdown, found=%v err=%v", jid, found, err)
+		}
+
+		recorder := httptest.NewRecorder()
+		req, newReqErr := http.NewRequest(http.MethodGet, "http://localhost/hash/"+strconv.FormatInt(int64(jid), 10), nil)
+		if newReqErr != nil {
+			t.Fatal("An error occured while creating the request: ", newReqErr)
+		}
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("GET /hash/%d after shutdown: expected status %d, got %d", jid, http.StatusOK, recorder.Code)
+		}
+	}
+}
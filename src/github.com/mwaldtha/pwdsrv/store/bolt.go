@@ -0,0 +1,88 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var hashesBucket = []byte("hashes")
+var countersBucket = []byte("counters")
+
+// boltStore is a Store backed by a bbolt database, suitable for a single
+// node that wants crash-safe persistence without running a separate
+// database server.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) the bbolt database at path.
+func NewBoltStore(path string) (Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening bolt database %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(hashesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(countersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store: initializing bolt database %q: %w", path, err)
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Put(jid int32, hash string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(hashesBucket).Put(jidKey(jid), []byte(hash))
+	})
+}
+
+func (s *boltStore) Get(jid int32) (string, bool, error) {
+	var hash string
+	var found bool
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(hashesBucket).Get(jidKey(jid)); v != nil {
+			hash = string(v)
+			found = true
+		}
+		return nil
+	})
+
+	return hash, found, err
+}
+
+//NextID relies on bbolt's own per-bucket sequence counter, which is
+//persisted with the database, so ids stay monotonic across restarts
+func (s *boltStore) NextID() (int32, error) {
+	var next int32
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(countersBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		next = int32(id)
+		return nil
+	})
+
+	return next, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func jidKey(jid int32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, uint32(jid))
+	return key
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fileStore is a Store backed by an append-only log on disk. Put appends
+// a new record; opening the store replays the log to recover both the
+// hashes map and the highest job id seen, so ids stay monotonic across
+// restarts. Close compacts the log down to one record per job id so it
+// doesn't grow without bound.
+type fileStore struct {
+	lock   sync.Mutex
+	path   string
+	file   *os.File
+	hashes map[int32]string
+	nextID int32
+}
+
+// NewFileStore opens (creating if necessary) the append-only log at path
+// and replays it to recover prior state.
+func NewFileStore(path string) (Store, error) {
+	s := &fileStore{path: path, hashes: make(map[int32]string)}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("store: opening file %q: %w", path, err)
+	}
+	s.file = f
+
+	return s, nil
+}
+
+func (s *fileStore) replay() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("store: replaying file %q: %w", s.path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		jid, hash, err := parseRecord(scanner.Text())
+		if err != nil {
+			return err
+		}
+		s.hashes[jid] = hash
+		if jid > s.nextID {
+			s.nextID = jid
+		}
+	}
+	return scanner.Err()
+}
+
+//parseRecord splits a "<jid>\t<hash>" log line into its job id and hash
+func parseRecord(line string) (int32, string, error) {
+	idx := strings.IndexByte(line, '\t')
+	if idx < 0 {
+		return 0, "", fmt.Errorf("store: malformed record %q", line)
+	}
+
+	jid, err := strconv.ParseInt(line[:idx], 10, 32)
+	if err != nil {
+		return 0, "", fmt.Errorf("store: malformed record %q: %w", line, err)
+	}
+
+	return int32(jid), line[idx+1:], nil
+}
+
+func (s *fileStore) Put(jid int32, hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := fmt.Fprintf(s.file, "%d\t%s\n", jid, hash); err != nil {
+		return fmt.Errorf("store: appending record for job id %d: %w", jid, err)
+	}
+	s.hashes[jid] = hash
+	return nil
+}
+
+func (s *fileStore) Get(jid int32) (string, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	hash, ok := s.hashes[jid]
+	return hash, ok, nil
+}
+
+func (s *fileStore) NextID() (int32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextID++
+	return s.nextID, nil
+}
+
+//Close compacts the log to a single record per job id and atomically
+//replaces the on-disk file with the compacted version
+func (s *fileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("store: creating compacted snapshot: %w", err)
+	}
+
+	for jid, hash := range s.hashes {
+		if _, err := fmt.Fprintf(tmp, "%d\t%s\n", jid, hash); err != nil {
+			tmp.Close()
+			return fmt.Errorf("store: writing compacted snapshot: %w", err)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("store: closing compacted snapshot: %w", err)
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("store: closing file %q: %w", s.path, err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("store: replacing file %q with compacted snapshot: %w", s.path, err)
+	}
+
+	return nil
+}
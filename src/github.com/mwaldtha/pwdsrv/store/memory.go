@@ -0,0 +1,42 @@
+package store
+
+import "sync"
+
+// memoryStore is the original in-memory Store: a map guarded by a mutex.
+// It is the default backend and matches prior behavior, including the
+// loss of all state across restarts.
+type memoryStore struct {
+	lock   sync.RWMutex
+	hashes map[int32]string
+	nextID int32
+}
+
+// NewMemoryStore returns a Store backed by an in-memory map.
+func NewMemoryStore() Store {
+	return &memoryStore{hashes: make(map[int32]string)}
+}
+
+func (s *memoryStore) Put(jid int32, hash string) error {
+	s.lock.Lock()
+	s.hashes[jid] = hash
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Get(jid int32) (string, bool, error) {
+	s.lock.RLock()
+	hash, ok := s.hashes[jid]
+	s.lock.RUnlock()
+	return hash, ok, nil
+}
+
+func (s *memoryStore) NextID() (int32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextID++
+	return s.nextID, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,46 @@
+// Package store provides pluggable persistence for computed password
+// hashes, keyed by job id. The file and bolt backends keep hashes and job
+// ids across process restarts; the default memory backend keeps nothing.
+package store
+
+import "fmt"
+
+// Store persists job hashes by job id.
+type Store interface {
+	// Put records the encoded hash for jid.
+	Put(jid int32, hash string) error
+	// Get returns the encoded hash for jid, and whether it was found.
+	Get(jid int32) (string, bool, error)
+	// NextID returns the next monotonically increasing job id. Ids must
+	// remain monotonic across restarts of the same backing store.
+	NextID() (int32, error)
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Backend identifies a supported Store implementation.
+type Backend string
+
+const (
+	Memory Backend = "memory"
+	File   Backend = "file"
+	Bolt   Backend = "bolt"
+)
+
+// DefaultBackend is used when no backend is explicitly configured.
+const DefaultBackend = Memory
+
+// New opens the Store for the named backend. path is ignored by Memory
+// and is the backing file/database path for File and Bolt.
+func New(backend Backend, path string) (Store, error) {
+	switch backend {
+	case Memory:
+		return NewMemoryStore(), nil
+	case File:
+		return NewFileStore(path)
+	case Bolt:
+		return NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("store: unsupported backend %q", backend)
+	}
+}
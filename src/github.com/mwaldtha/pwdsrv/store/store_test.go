@@ -0,0 +1,147 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+//Test the basic Put/Get/NextID contract against every backend
+func TestPutGetNextID(t *testing.T) {
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+	}
+
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "hashes.log"))
+	if err != nil {
+		t.Fatalf("NewFileStore: unexpected error: %v", err)
+	}
+	stores["file"] = fileStore
+
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "hashes.db"))
+	if err != nil {
+		t.Fatalf("NewBoltStore: unexpected error: %v", err)
+	}
+	stores["bolt"] = boltStore
+
+	for name, s := range stores {
+		if _, found, err := s.Get(1); err != nil || found {
+			t.Errorf("%s: Get before Put: expected not found, got found=%v err=%v", name, found, err)
+		}
+
+		first, err := s.NextID()
+		if err != nil {
+			t.Fatalf("%s: NextID: unexpected error: %v", name, err)
+		}
+		second, err := s.NextID()
+		if err != nil {
+			t.Fatalf("%s: NextID: unexpected error: %v", name, err)
+		}
+		if second <= first {
+			t.Errorf("%s: NextID: expected %d > %d", name, second, first)
+		}
+
+		if err := s.Put(first, "encoded-hash"); err != nil {
+			t.Fatalf("%s: Put: unexpected error: %v", name, err)
+		}
+
+		hash, found, err := s.Get(first)
+		if err != nil {
+			t.Fatalf("%s: Get: unexpected error: %v", name, err)
+		}
+		if !found || hash != "encoded-hash" {
+			t.Errorf("%s: Get: expected ('encoded-hash', true), got (%q, %v)", name, hash, found)
+		}
+
+		if err := s.Close(); err != nil {
+			t.Errorf("%s: Close: unexpected error: %v", name, err)
+		}
+	}
+}
+
+//Test that a FileStore recovers its hashes and NextID counter after
+//being closed and reopened against the same path
+func TestFileStoreRecoversAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hashes.log")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: unexpected error: %v", err)
+	}
+
+	jid, err := s.NextID()
+	if err != nil {
+		t.Fatalf("NextID: unexpected error: %v", err)
+	}
+	if err := s.Put(jid, "encoded-hash"); err != nil {
+		t.Fatalf("Put: unexpected error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore (reopen): unexpected error: %v", err)
+	}
+	defer reopened.Close()
+
+	hash, found, err := reopened.Get(jid)
+	if err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if !found || hash != "encoded-hash" {
+		t.Errorf("Get: expected ('encoded-hash', true), got (%q, %v)", hash, found)
+	}
+
+	next, err := reopened.NextID()
+	if err != nil {
+		t.Fatalf("NextID: unexpected error: %v", err)
+	}
+	if next <= jid {
+		t.Errorf("NextID after reopen: expected > %d, got %d", jid, next)
+	}
+}
+
+//Test that a BoltStore recovers its hashes and NextID counter after
+//being closed and reopened against the same database file
+func TestBoltStoreRecoversAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hashes.db")
+
+	s, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore: unexpected error: %v", err)
+	}
+
+	jid, err := s.NextID()
+	if err != nil {
+		t.Fatalf("NextID: unexpected error: %v", err)
+	}
+	if err := s.Put(jid, "encoded-hash"); err != nil {
+		t.Fatalf("Put: unexpected error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	reopened, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltStore (reopen): unexpected error: %v", err)
+	}
+	defer reopened.Close()
+
+	hash, found, err := reopened.Get(jid)
+	if err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if !found || hash != "encoded-hash" {
+		t.Errorf("Get: expected ('encoded-hash', true), got (%q, %v)", hash, found)
+	}
+
+	next, err := reopened.NextID()
+	if err != nil {
+		t.Fatalf("NextID: unexpected error: %v", err)
+	}
+	if next <= jid {
+		t.Errorf("NextID after reopen: expected > %d, got %d", jid, next)
+	}
+}
@@ -0,0 +1,84 @@
+// Package workerpool provides a bounded pool of goroutines that process
+// submitted jobs off the caller's goroutine, so that e.g. an HTTP handler
+// can return immediately while the actual work (password hashing) happens
+// in the background. Shutdown lets a caller wait for queued and in-flight
+// jobs to finish, bounded by a context deadline.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Job is a unit of work submitted to a Pool.
+type Job func()
+
+// ErrPoolClosed is returned by Submit once Shutdown has been called.
+var ErrPoolClosed = errors.New("workerpool: pool is shut down")
+
+// Pool is a fixed-size pool of worker goroutines draining a bounded queue.
+type Pool struct {
+	jobs   chan Job
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New starts a Pool with the given number of worker goroutines, each
+// pulling from a queue that holds up to queueSize pending jobs.
+func New(workers, queueSize int) *Pool {
+	p := &Pool{jobs: make(chan Job, queueSize)}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		job()
+	}
+}
+
+// Submit enqueues job for processing by a worker. It blocks if the queue
+// is full. It returns ErrPoolClosed instead of sending if Shutdown has
+// already been called, so a caller racing a shutdown gets a clean error
+// rather than a send on a closed channel.
+func (p *Pool) Submit(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+	p.jobs <- job
+	return nil
+}
+
+// Shutdown stops accepting new jobs and waits for all queued and
+// in-flight jobs to complete. It returns ctx's error if ctx is done
+// before the pool drains.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	close(p.jobs)
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
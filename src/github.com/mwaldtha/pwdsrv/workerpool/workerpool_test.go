@@ -0,0 +1,104 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//Test that every submitted job runs exactly once
+func TestPoolRunsAllJobs(t *testing.T) {
+	p := New(4, 10)
+
+	var completed int32
+	const jobCount = 50
+
+	for i := 0; i < jobCount; i++ {
+		p.Submit(func() { atomic.AddInt32(&completed, 1) })
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: unexpected error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&completed); got != jobCount {
+		t.Errorf("expected %d completed jobs, got %d", jobCount, got)
+	}
+}
+
+//Test that Shutdown waits for a slow job to finish before returning
+func TestShutdownWaitsForInFlightJob(t *testing.T) {
+	p := New(1, 1)
+
+	var done int32
+	p.Submit(func() {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&done, 1)
+	})
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: unexpected error: %v", err)
+	}
+
+	if atomic.LoadInt32(&done) != 1 {
+		t.Error("expected in-flight job to complete before Shutdown returned")
+	}
+}
+
+//Test that Shutdown returns the context's error if jobs don't drain in time
+func TestShutdownRespectsContextDeadline(t *testing.T) {
+	p := New(1, 1)
+
+	p.Submit(func() { time.Sleep(200 * time.Millisecond) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+//Test that Submit fails safely instead of sending on a closed channel
+//once Shutdown has closed the queue
+func TestSubmitAfterShutdownReturnsError(t *testing.T) {
+	p := New(1, 1)
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: unexpected error: %v", err)
+	}
+
+	if err := p.Submit(func() {}); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+}
+
+//Test that a Submit racing a timed-out Shutdown never panics and always
+//reports ErrPoolClosed once the pool is actually closed
+func TestSubmitRaceWithShutdownDoesNotPanic(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		p := New(1, 1)
+		p.Submit(func() { time.Sleep(time.Millisecond) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Microsecond)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Submit(func() {}); err != nil && err != ErrPoolClosed {
+				t.Errorf("Submit racing Shutdown: expected nil or ErrPoolClosed, got %v", err)
+			}
+		}()
+
+		p.Shutdown(ctx)
+		cancel()
+		wg.Wait()
+
+		if err := p.Submit(func() {}); err != ErrPoolClosed {
+			t.Errorf("Submit after Shutdown: expected ErrPoolClosed, got %v", err)
+		}
+	}
+}